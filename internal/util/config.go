@@ -0,0 +1,27 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package util
+
+// Config holds the v23/jiri tools configuration loaded from conf.json.
+type Config struct {
+	Go                []string           `json:"goWorkspaces"`
+	VDL               []string           `json:"vdlWorkspaces"`
+	CrossProfileSpecs []CrossProfileSpec `json:"crossProfiles"`
+}
+
+// GoWorkspaces returns the vanadium Go workspaces.
+func (c *Config) GoWorkspaces() []string {
+	return c.Go
+}
+
+// VDLWorkspaces returns the vanadium VDL workspaces.
+func (c *Config) VDLWorkspaces() []string {
+	return c.VDL
+}
+
+// CrossProfiles returns the CrossProfiles declared in conf.json.
+func (c *Config) CrossProfiles() []CrossProfileSpec {
+	return c.CrossProfileSpecs
+}
@@ -0,0 +1,244 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package util
+
+import (
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"v.io/x/devtools/internal/envutil"
+)
+
+// CrossProfile recognizes a cross-compilation target and sets up the
+// environment variables needed to build for it.
+type CrossProfile interface {
+	// Matches reports whether this profile handles the given platform.
+	Matches(platform Platform) bool
+	// Setup configures env for cross-compiling to platform, rooted at
+	// the given vanadium root.
+	Setup(env *envutil.Snapshot, root string, platform Platform) error
+}
+
+var (
+	// mu guards profiles and registeredConfigProfiles below.
+	mu sync.Mutex
+
+	// profiles holds the registered CrossProfiles, most-recently-registered
+	// first, so conf.json profiles can override the built-ins.
+	profiles []CrossProfile
+
+	// registeredConfigProfiles tracks the names of conf.json profiles
+	// already registered, so repeated VanadiumEnvironment calls in the
+	// same process don't re-register them.
+	registeredConfigProfiles = map[string]bool{}
+)
+
+// RegisterProfile registers a CrossProfile for use by VanadiumEnvironment.
+// A profile registered later takes precedence over one registered
+// earlier for the same platform.
+func RegisterProfile(p CrossProfile) {
+	mu.Lock()
+	defer mu.Unlock()
+	profiles = append([]CrossProfile{p}, profiles...)
+}
+
+func init() {
+	RegisterProfile(androidProfile{})
+	RegisterProfile(armLinuxProfile{})
+	RegisterProfile(arm64LinuxProfile{})
+	RegisterProfile(mipsleLinuxProfile{})
+	RegisterProfile(darwinCrossProfile{})
+	RegisterProfile(naclProfile{})
+}
+
+// lookupProfile returns the first registered CrossProfile that matches
+// platform.
+func lookupProfile(platform Platform) (CrossProfile, bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	for _, p := range profiles {
+		if p.Matches(platform) {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+// registerConfigProfiles registers the CrossProfiles declared in the
+// tools configuration file, so they take precedence over the built-ins
+// for any target they also cover.
+func registerConfigProfiles(config *Config) {
+	mu.Lock()
+	defer mu.Unlock()
+	for _, spec := range config.CrossProfiles() {
+		if registeredConfigProfiles[spec.Name] {
+			continue
+		}
+		profiles = append([]CrossProfile{configProfile{spec}}, profiles...)
+		registeredConfigProfiles[spec.Name] = true
+	}
+}
+
+// configProfile is a CrossProfile driven entirely by a conf.json entry.
+type configProfile struct {
+	spec CrossProfileSpec
+}
+
+func (p configProfile) Matches(platform Platform) bool {
+	return platform.OS == p.spec.OS && platform.Arch == p.spec.Arch
+}
+
+func (p configProfile) Setup(env *envutil.Snapshot, root string, platform Platform) error {
+	env.Set("GOOS", platform.OS)
+	env.Set("GOARCH", platform.Arch)
+	if platform.SubArch != "" {
+		env.Set("GOARM", strings.TrimPrefix(platform.SubArch, "v"))
+	}
+	if p.spec.ToolchainRoot != "" {
+		path := env.GetTokens("PATH", ":")
+		path = append([]string{filepath.Join(root, p.spec.ToolchainRoot)}, path...)
+		env.SetTokens("PATH", path, ":")
+	}
+	if p.spec.Sysroot != "" {
+		env.Set("CGO_ENABLED", "1")
+		sysroot := filepath.Join(root, p.spec.Sysroot)
+		cflags := env.GetTokens("CGO_CFLAGS", " ")
+		cflags = append(cflags, "--sysroot="+sysroot)
+		env.SetTokens("CGO_CFLAGS", cflags, " ")
+		ldflags := env.GetTokens("CGO_LDFLAGS", " ")
+		ldflags = append(ldflags, "--sysroot="+sysroot)
+		env.SetTokens("CGO_LDFLAGS", ldflags, " ")
+	}
+	for key, value := range p.spec.Env {
+		env.Set(key, value)
+	}
+	return nil
+}
+
+// androidProfile is the built-in CrossProfile for android targets.
+type androidProfile struct{}
+
+func (androidProfile) Matches(platform Platform) bool {
+	_, ok := androidToolchainArch[platform.Arch]
+	return ok && platform.OS == "android"
+}
+
+func (androidProfile) Setup(env *envutil.Snapshot, root string, platform Platform) error {
+	return setAndroidEnv(env, platform)
+}
+
+// armLinuxProfile is the built-in CrossProfile for arm/linux targets.
+type armLinuxProfile struct{}
+
+func (armLinuxProfile) Matches(platform Platform) bool {
+	return platform.Arch == "arm" && platform.OS == "linux"
+}
+
+func (armLinuxProfile) Setup(env *envutil.Snapshot, root string, platform Platform) error {
+	return setArmEnv(env, platform)
+}
+
+// arm64LinuxProfile is the built-in CrossProfile for arm64/linux targets.
+type arm64LinuxProfile struct{}
+
+func (arm64LinuxProfile) Matches(platform Platform) bool {
+	return platform.Arch == "arm64" && platform.OS == "linux"
+}
+
+func (arm64LinuxProfile) Setup(env *envutil.Snapshot, root string, platform Platform) error {
+	env.Set("GOARCH", platform.Arch)
+	env.Set("GOOS", platform.OS)
+	path := env.GetTokens("PATH", ":")
+	path = append([]string{
+		filepath.Join(root, "third_party", "cout", "xgcc", "cross_arm64"),
+		filepath.Join(root, "third_party", "repos", "go_arm64", "bin"),
+	}, path...)
+	env.SetTokens("PATH", path, ":")
+	return nil
+}
+
+// mipsleLinuxProfile is the built-in CrossProfile for mipsle/linux targets.
+type mipsleLinuxProfile struct{}
+
+func (mipsleLinuxProfile) Matches(platform Platform) bool {
+	return platform.Arch == "mipsle" && platform.OS == "linux"
+}
+
+func (mipsleLinuxProfile) Setup(env *envutil.Snapshot, root string, platform Platform) error {
+	env.Set("GOARCH", platform.Arch)
+	env.Set("GOOS", platform.OS)
+	path := env.GetTokens("PATH", ":")
+	path = append([]string{
+		filepath.Join(root, "third_party", "cout", "xgcc", "cross_mipsle"),
+		filepath.Join(root, "third_party", "repos", "go_mipsle", "bin"),
+	}, path...)
+	env.SetTokens("PATH", path, ":")
+	return nil
+}
+
+// darwinToolchainArch maps a Go arch to the cross-darwin clang triple.
+var darwinToolchainArch = map[string]string{
+	"amd64": "x86_64-apple-darwin14",
+	"arm64": "aarch64-apple-darwin14",
+}
+
+// darwinCrossProfile is the built-in CrossProfile for cross-compiling to
+// darwin from a non-darwin host.
+type darwinCrossProfile struct{}
+
+func (darwinCrossProfile) Matches(platform Platform) bool {
+	_, ok := darwinToolchainArch[platform.Arch]
+	return ok && platform.OS == "darwin" && runtime.GOOS != "darwin"
+}
+
+func (darwinCrossProfile) Setup(env *envutil.Snapshot, root string, platform Platform) error {
+	triple, ok := darwinToolchainArch[platform.Arch]
+	if !ok {
+		return UnsupportedPlatformErr{platform}
+	}
+	env.Set("GOARCH", platform.Arch)
+	env.Set("GOOS", platform.OS)
+	env.Set("CGO_ENABLED", "1")
+	path := env.GetTokens("PATH", ":")
+	path = append([]string{
+		filepath.Join(root, "third_party", "cout", "xgcc", "cross_darwin"),
+	}, path...)
+	env.SetTokens("PATH", path, ":")
+	env.Set("CC", triple+"-clang")
+	env.Set("CXX", triple+"-clang++")
+	return nil
+}
+
+// naclProfile is the built-in CrossProfile for nacl targets.
+type naclProfile struct{}
+
+func (naclProfile) Matches(platform Platform) bool {
+	return (platform.Arch == "386" || platform.Arch == "amd64p32") && platform.OS == "nacl"
+}
+
+func (naclProfile) Setup(env *envutil.Snapshot, root string, platform Platform) error {
+	return setNaclEnv(env, platform)
+}
+
+// CrossProfileSpec is the conf.json representation of a CrossProfile. It
+// lets downstream users add new cross-compilation targets without
+// patching util.go.
+type CrossProfileSpec struct {
+	// Name identifies the profile, so that registerConfigProfiles
+	// registers each named profile only once.
+	Name string `json:"name"`
+	// OS and Arch are the GOOS/GOARCH values the profile handles.
+	OS   string `json:"os"`
+	Arch string `json:"arch"`
+	// ToolchainRoot is a vanadium-root-relative directory prepended to PATH.
+	ToolchainRoot string `json:"toolchainRoot"`
+	// Sysroot is a vanadium-root-relative --sysroot directory; setting
+	// it enables CGO.
+	Sysroot string `json:"sysroot"`
+	// Env holds additional environment variable overrides.
+	Env map[string]string `json:"env"`
+}
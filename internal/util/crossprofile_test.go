@@ -0,0 +1,65 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package util
+
+import "testing"
+
+func TestProfileMatches(t *testing.T) {
+	tests := []struct {
+		profile  CrossProfile
+		platform Platform
+		want     bool
+	}{
+		{androidProfile{}, Platform{OS: "android", Arch: "arm"}, true},
+		{androidProfile{}, Platform{OS: "android", Arch: "arm64"}, true},
+		{androidProfile{}, Platform{OS: "linux", Arch: "arm"}, false},
+		{armLinuxProfile{}, Platform{OS: "linux", Arch: "arm"}, true},
+		{armLinuxProfile{}, Platform{OS: "linux", Arch: "arm64"}, false},
+		{arm64LinuxProfile{}, Platform{OS: "linux", Arch: "arm64"}, true},
+		{mipsleLinuxProfile{}, Platform{OS: "linux", Arch: "mipsle"}, true},
+		{naclProfile{}, Platform{OS: "nacl", Arch: "386"}, true},
+		{naclProfile{}, Platform{OS: "nacl", Arch: "amd64p32"}, true},
+		{naclProfile{}, Platform{OS: "nacl", Arch: "arm"}, false},
+		{darwinCrossProfile{}, Platform{OS: "darwin", Arch: "amd64"}, true},
+		{darwinCrossProfile{}, Platform{OS: "darwin", Arch: "arm64"}, true},
+		{darwinCrossProfile{}, Platform{OS: "darwin", Arch: "386"}, false},
+	}
+	for _, test := range tests {
+		if got := test.profile.Matches(test.platform); got != test.want {
+			t.Errorf("%T.Matches(%v) = %v, want %v", test.profile, test.platform, got, test.want)
+		}
+	}
+}
+
+func TestDarwinToolchainArchPerArch(t *testing.T) {
+	if got, want := darwinToolchainArch["amd64"], "x86_64-apple-darwin14"; got != want {
+		t.Errorf("darwinToolchainArch[amd64] = %q, want %q", got, want)
+	}
+	if got, want := darwinToolchainArch["arm64"], "aarch64-apple-darwin14"; got != want {
+		t.Errorf("darwinToolchainArch[arm64] = %q, want %q", got, want)
+	}
+}
+
+func TestRegisterProfileTakesPrecedence(t *testing.T) {
+	mu.Lock()
+	saved := profiles
+	mu.Unlock()
+	defer func() {
+		mu.Lock()
+		profiles = saved
+		mu.Unlock()
+	}()
+
+	// linux/arm64 is also matched by the built-in arm64LinuxProfile.
+	platform := Platform{OS: "linux", Arch: "arm64"}
+	RegisterProfile(configProfile{CrossProfileSpec{Name: "test-linux-arm64", OS: "linux", Arch: "arm64"}})
+	profile, ok := lookupProfile(platform)
+	if !ok {
+		t.Fatalf("lookupProfile(%v) found no match", platform)
+	}
+	if _, ok := profile.(configProfile); !ok {
+		t.Errorf("lookupProfile(%v) = %T, want configProfile", platform, profile)
+	}
+}
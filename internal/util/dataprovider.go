@@ -0,0 +1,167 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"v.io/x/devtools/internal/tool"
+)
+
+// ConfigRepo, if set, is the git repository URL tool configuration data
+// is fetched from. It is set from the --config-repo flag.
+var ConfigRepo string
+
+// DataProvider locates and loads the configuration data for a jiri tool.
+type DataProvider interface {
+	// ConfigPath returns the path to the named configuration file, e.g.
+	// "conf.json" or "buildcop.xml".
+	ConfigPath(name string) (string, error)
+	// Load reads the named configuration file and unmarshals it as
+	// JSON into v.
+	Load(name string, v interface{}) error
+}
+
+// NewDataProvider returns the DataProvider to use for toolName: a
+// --config-repo URL if ConfigRepo is set, else $XDG_CONFIG_HOME/jiri/<tool>
+// if present, else the manifest project's data directory.
+func NewDataProvider(ctx *tool.Context, toolName string) DataProvider {
+	if toolName == "" {
+		// If the tool name is not set, use "v23" as the default. As a
+		// consequence, any manifest is assumed to specify a "v23" tool.
+		toolName = "v23"
+	}
+	if ConfigRepo != "" {
+		return &urlDataProvider{repo: ConfigRepo, toolName: toolName}
+	}
+	if dir := xdgConfigDir(toolName); dir != "" {
+		if _, err := os.Stat(dir); err == nil {
+			return &dirDataProvider{dir: dir}
+		}
+	}
+	return &manifestDataProvider{ctx: ctx, toolName: toolName}
+}
+
+// xdgConfigDir returns $XDG_CONFIG_HOME/jiri/<tool>, or "" if
+// XDG_CONFIG_HOME is not set.
+func xdgConfigDir(toolName string) string {
+	home := os.Getenv("XDG_CONFIG_HOME")
+	if home == "" {
+		return ""
+	}
+	return filepath.Join(home, "jiri", toolName)
+}
+
+// manifestDataProvider reads configuration data out of the data
+// directory of the project that hosts toolName in the current manifest.
+type manifestDataProvider struct {
+	ctx      *tool.Context
+	toolName string
+}
+
+func (p *manifestDataProvider) ConfigPath(name string) (string, error) {
+	dataDir, err := DataDirPath(p.ctx, p.toolName)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dataDir, name), nil
+}
+
+func (p *manifestDataProvider) Load(name string, v interface{}) error {
+	path, err := p.ConfigPath(name)
+	if err != nil {
+		return err
+	}
+	return loadJSON(path, v)
+}
+
+// dirDataProvider reads configuration data out of a plain directory,
+// used for $XDG_CONFIG_HOME/jiri/<tool>.
+type dirDataProvider struct {
+	dir string
+}
+
+func (p *dirDataProvider) ConfigPath(name string) (string, error) {
+	return filepath.Join(p.dir, name), nil
+}
+
+func (p *dirDataProvider) Load(name string, v interface{}) error {
+	path, err := p.ConfigPath(name)
+	if err != nil {
+		return err
+	}
+	return loadJSON(path, v)
+}
+
+// urlDataProvider reads configuration data out of a git repository
+// declared via --config-repo, caching a checkout under
+// $V23_ROOT/.cache/config-repo/<tool>.
+type urlDataProvider struct {
+	repo     string
+	toolName string
+}
+
+func (p *urlDataProvider) checkoutDir() (string, error) {
+	root, err := V23Root()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(root, ".cache", "config-repo", p.toolName), nil
+}
+
+func (p *urlDataProvider) ensureCheckout() (string, error) {
+	dir, err := p.checkoutDir()
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+		cmd := exec.Command("git", "-C", dir, "pull", "--ff-only")
+		if err := cmd.Run(); err != nil {
+			return "", fmt.Errorf("%v failed: %v", cmd.Args, err)
+		}
+		return dir, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+		return "", fmt.Errorf("MkdirAll(%v) failed: %v", filepath.Dir(dir), err)
+	}
+	cmd := exec.Command("git", "clone", p.repo, dir)
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%v failed: %v", cmd.Args, err)
+	}
+	return dir, nil
+}
+
+func (p *urlDataProvider) ConfigPath(name string) (string, error) {
+	dir, err := p.ensureCheckout()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, p.toolName, name), nil
+}
+
+func (p *urlDataProvider) Load(name string, v interface{}) error {
+	path, err := p.ConfigPath(name)
+	if err != nil {
+		return err
+	}
+	return loadJSON(path, v)
+}
+
+// loadJSON reads the file at path and unmarshals it as JSON into v.
+func loadJSON(path string, v interface{}) error {
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("ReadFile(%v) failed: %v", path, err)
+	}
+	if err := json.Unmarshal(bytes, v); err != nil {
+		return fmt.Errorf("Unmarshal(%v) failed: %v", path, err)
+	}
+	return nil
+}
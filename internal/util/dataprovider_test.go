@@ -0,0 +1,65 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewDataProviderSelection(t *testing.T) {
+	oldConfigRepo, oldXDG := ConfigRepo, os.Getenv("XDG_CONFIG_HOME")
+	defer func() {
+		ConfigRepo = oldConfigRepo
+		os.Setenv("XDG_CONFIG_HOME", oldXDG)
+	}()
+
+	ConfigRepo = "https://example.com/config.git"
+	os.Unsetenv("XDG_CONFIG_HOME")
+	p := NewDataProvider(nil, "v23")
+	if _, ok := p.(*urlDataProvider); !ok {
+		t.Errorf("NewDataProvider() = %T, want *urlDataProvider when ConfigRepo is set", p)
+	}
+	ConfigRepo = ""
+
+	xdgDir, err := ioutil.TempDir("", "jiri-test-")
+	if err != nil {
+		t.Fatalf("TempDir() failed: %v", err)
+	}
+	defer os.RemoveAll(xdgDir)
+	toolDir := filepath.Join(xdgDir, "jiri", "v23")
+	if err := os.MkdirAll(toolDir, 0755); err != nil {
+		t.Fatalf("MkdirAll(%v) failed: %v", toolDir, err)
+	}
+	os.Setenv("XDG_CONFIG_HOME", xdgDir)
+	p = NewDataProvider(nil, "v23")
+	if _, ok := p.(*dirDataProvider); !ok {
+		t.Errorf("NewDataProvider() = %T, want *dirDataProvider when $XDG_CONFIG_HOME/jiri/<tool> exists", p)
+	}
+
+	os.Unsetenv("XDG_CONFIG_HOME")
+	p = NewDataProvider(nil, "v23")
+	if _, ok := p.(*manifestDataProvider); !ok {
+		t.Errorf("NewDataProvider() = %T, want *manifestDataProvider when neither ConfigRepo nor $XDG_CONFIG_HOME apply", p)
+	}
+}
+
+func TestXDGConfigDir(t *testing.T) {
+	old := os.Getenv("XDG_CONFIG_HOME")
+	defer os.Setenv("XDG_CONFIG_HOME", old)
+
+	os.Unsetenv("XDG_CONFIG_HOME")
+	if got := xdgConfigDir("v23"); got != "" {
+		t.Errorf("xdgConfigDir() = %q, want \"\"", got)
+	}
+
+	os.Setenv("XDG_CONFIG_HOME", "/home/user/.config")
+	want := filepath.Join("/home/user/.config", "jiri", "v23")
+	if got := xdgConfigDir("v23"); got != want {
+		t.Errorf("xdgConfigDir() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package util
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"v.io/x/devtools/internal/envutil"
+)
+
+const (
+	// nativeBackend cross-compiles using host-installed toolchains, as
+	// selected by the CrossProfile registry.
+	nativeBackend = "native"
+	// dockerBackend cross-compiles inside a per-target Docker image.
+	dockerBackend = "docker"
+)
+
+// Backend selects how VanadiumEnvironment materializes a build
+// environment. It is set from the --backend flag by tools that invoke
+// VanadiumEnvironment.
+var Backend = nativeBackend
+
+// dockerImageFmt names the xbuild image for a given GOOS/GOARCH pair,
+// e.g. "vanadium/xbuild:linux-arm" or "vanadium/xbuild:windows-amd64".
+const dockerImageFmt = "vanadium/xbuild:%s-%s"
+
+// dockerContainerRoot is the path at which the vanadium root is
+// bind-mounted inside the xbuild containers.
+const dockerContainerRoot = "/v23"
+
+// DockerImage returns the xbuild image used to cross-compile for
+// platform.
+func DockerImage(platform Platform) string {
+	return fmt.Sprintf(dockerImageFmt, platform.OS, platform.Arch)
+}
+
+// DockerRunArgs returns the "docker run" arguments needed to execute cmd
+// inside the xbuild container for platform, with root bind-mounted at
+// dockerContainerRoot and the container-rooted cross-compilation
+// variables from dockerEnvVars passed through as "-e" flags.
+func DockerRunArgs(root string, config *Config, platform Platform, cmd ...string) []string {
+	args := []string{
+		"run", "--rm",
+		"-v", fmt.Sprintf("%s:%s", root, dockerContainerRoot),
+		"-w", dockerContainerRoot,
+	}
+	for _, v := range dockerEnvVars(config, platform) {
+		args = append(args, "-e", v)
+	}
+	args = append(args, DockerImage(platform))
+	return append(args, cmd...)
+}
+
+// RunInDocker runs cmd inside the xbuild container for platform, with
+// root bind-mounted at dockerContainerRoot, and streams its output to
+// os.Stdout/os.Stderr.
+func RunInDocker(root string, config *Config, platform Platform, cmd ...string) error {
+	dockerCmd := exec.Command("docker", DockerRunArgs(root, config, platform, cmd...)...)
+	dockerCmd.Stdout = os.Stdout
+	dockerCmd.Stderr = os.Stderr
+	if err := dockerCmd.Run(); err != nil {
+		return fmt.Errorf("%v failed: %v", dockerCmd.Args, err)
+	}
+	return nil
+}
+
+// dockerEnvVars returns the "KEY=VALUE" environment variables needed to
+// cross-compile for platform inside the xbuild container, with GOPATH and
+// VDLPATH rewritten to the container-rooted workspace paths.
+func dockerEnvVars(config *Config, platform Platform) []string {
+	vars := []string{
+		"CGO_ENABLED=1",
+		"GOOS=" + platform.OS,
+		"GOARCH=" + platform.Arch,
+		"CC=cc",
+		"CXX=c++",
+	}
+	if platform.SubArch != "" {
+		vars = append(vars, "GOARM="+strings.TrimPrefix(platform.SubArch, "v"))
+	}
+
+	var gopath []string
+	for _, workspace := range config.GoWorkspaces() {
+		gopath = append(gopath, filepath.Join(dockerContainerRoot, workspace))
+	}
+	vars = append(vars, "GOPATH="+strings.Join(gopath, ":"))
+
+	var vdlpath []string
+	for _, workspace := range config.VDLWorkspaces() {
+		vdlpath = append(vdlpath, filepath.Join(dockerContainerRoot, workspace))
+	}
+	vars = append(vars, "VDLPATH="+strings.Join(vdlpath, ":"))
+	return vars
+}
+
+// setDockerEnv configures env so that GOPATH, VDLPATH, and the Go
+// cross-compilation variables are valid inside the xbuild container for
+// platform, rather than on the host.
+func setDockerEnv(env *envutil.Snapshot, root string, config *Config, platform Platform) error {
+	for _, v := range dockerEnvVars(config, platform) {
+		parts := strings.SplitN(v, "=", 2)
+		key, val := parts[0], parts[1]
+		if (key == "GOPATH" || key == "VDLPATH") && val != "" {
+			env.SetTokens(key, strings.Split(val, ":"), ":")
+			continue
+		}
+		env.Set(key, val)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package util
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDockerRunArgsIncludesContainerEnv(t *testing.T) {
+	config := &Config{Go: []string{"go"}, VDL: []string{"vdl"}}
+	platform := Platform{OS: "linux", Arch: "arm", SubArch: "v7"}
+	args := DockerRunArgs("/v23root", config, platform, "go", "build")
+
+	want := []string{
+		"run", "--rm",
+		"-v", "/v23root:/v23",
+		"-w", "/v23",
+		"-e", "CGO_ENABLED=1",
+		"-e", "GOOS=linux",
+		"-e", "GOARCH=arm",
+		"-e", "CC=cc",
+		"-e", "CXX=c++",
+		"-e", "GOARM=7",
+		"-e", "GOPATH=/v23/go",
+		"-e", "VDLPATH=/v23/vdl",
+		"vanadium/xbuild:linux-arm",
+		"go", "build",
+	}
+	if !reflect.DeepEqual(args, want) {
+		t.Errorf("DockerRunArgs() = %v, want %v", args, want)
+	}
+}
+
+func TestRunInDockerInvokesDocker(t *testing.T) {
+	// RunInDocker execs the "docker" binary directly, so this test only
+	// checks that a failure names the docker command it tried to run,
+	// without requiring docker to be installed.
+	config := &Config{}
+	platform := Platform{OS: "linux", Arch: "amd64"}
+	err := RunInDocker("/v23root", config, platform, "true")
+	if err == nil {
+		return
+	}
+	if !strings.Contains(err.Error(), "docker") {
+		t.Errorf("RunInDocker() error = %v, want it to reference the docker command", err)
+	}
+}
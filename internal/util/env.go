@@ -5,9 +5,7 @@
 package util
 
 import (
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -19,8 +17,33 @@ import (
 
 const (
 	rootEnv = "V23_ROOT"
+
+	// defaultAndroidAPILevel is the Android API level used for
+	// cross-compilation when Platform.AndroidAPILevel is not set.
+	defaultAndroidAPILevel = 21
 )
 
+// NDKHome, if non-empty, overrides the discovered Android NDK location.
+// It is set from the --ndk flag by tools that invoke VanadiumEnvironment.
+var NDKHome string
+
+// androidToolchainArch maps a Go arch to the NDK's toolchain triple.
+var androidToolchainArch = map[string]string{
+	"arm":   "arm-linux-androideabi",
+	"arm64": "aarch64-linux-android",
+	"386":   "i686-linux-android",
+	"amd64": "x86_64-linux-android",
+}
+
+// androidNDKSysrootArch maps a Go arch to the NDK's per-arch sysroot
+// directory name.
+var androidNDKSysrootArch = map[string]string{
+	"arm":   "arch-arm",
+	"arm64": "arch-arm64",
+	"386":   "arch-x86",
+	"amd64": "arch-x86_64",
+}
+
 // LocalManifestFile returns the path to the local manifest.
 func LocalManifestFile() (string, error) {
 	root, err := V23Root()
@@ -114,18 +137,9 @@ func DataDirPath(ctx *tool.Context, toolName string) (string, error) {
 
 // LoadConfig loads the tools configuration file into memory.
 func LoadConfig(ctx *tool.Context) (*Config, error) {
-	dataDir, err := DataDirPath(ctx, tool.Name)
-	if err != nil {
-		return nil, err
-	}
-	configPath := filepath.Join(dataDir, "conf.json")
-	configBytes, err := ioutil.ReadFile(configPath)
-	if err != nil {
-		return nil, fmt.Errorf("ReadFile(%v) failed: %v", configPath, err)
-	}
 	var config Config
-	if err := json.Unmarshal(configBytes, &config); err != nil {
-		return nil, fmt.Errorf("Unmarshal(%v) failed: %v", string(configBytes), err)
+	if err := NewDataProvider(ctx, tool.Name).Load("conf.json", &config); err != nil {
+		return nil, err
 	}
 	return &config, nil
 }
@@ -136,7 +150,6 @@ func LoadConfig(ctx *tool.Context) (*Config, error) {
 // every invocation of this function updates this original state
 // according to the current config of the v23 tool.
 func VanadiumEnvironment(ctx *tool.Context, platform Platform) (*envutil.Snapshot, error) {
-	env := envutil.NewSnapshotFromOS()
 	root, err := V23Root()
 	if err != nil {
 		return nil, err
@@ -145,34 +158,37 @@ func VanadiumEnvironment(ctx *tool.Context, platform Platform) (*envutil.Snapsho
 	if err != nil {
 		return nil, err
 	}
-	setGoPath(env, root, config)
+	if Backend == dockerBackend {
+		env := envutil.NewSnapshotFromOS()
+		if err := setDockerEnv(env, root, config, platform); err != nil {
+			return nil, err
+		}
+		return env, nil
+	}
+	env := envutil.NewSnapshotFromOS()
+	goroot, err := EnsureGoToolchain(ctx)
+	if err != nil {
+		return nil, err
+	}
+	setGoPath(env, root, config, goroot)
 	setVdlPath(env, root, config)
 	if platform.OS == "darwin" || platform.OS == "linux" {
 		if err := setSyncbaseCgoEnv(env, root, platform.OS); err != nil {
 			return nil, err
 		}
 	}
-	switch {
-	case platform.Arch == runtime.GOARCH && platform.OS == runtime.GOOS:
+	registerConfigProfiles(config)
+	if platform.Arch == runtime.GOARCH && platform.OS == runtime.GOOS {
 		// If setting up the environment for the host, we are done.
-	case platform.Arch == "arm" && platform.OS == "linux":
-		// Set up cross-compilation for arm / linux.
-		if err := setArmEnv(env, platform); err != nil {
-			return nil, err
-		}
-	case platform.Arch == "arm" && platform.OS == "android":
-		// Set up cross-compilation for arm / android.
-		if err := setAndroidEnv(env, platform); err != nil {
-			return nil, err
-		}
-	case (platform.Arch == "386" || platform.Arch == "amd64p32") && platform.OS == "nacl":
-		// Set up cross-compilation nacl.
-		if err := setNaclEnv(env, platform); err != nil {
-			return nil, err
-		}
-	default:
+		return env, nil
+	}
+	profile, ok := lookupProfile(platform)
+	if !ok {
 		return nil, UnsupportedPlatformErr{platform}
 	}
+	if err := profile.Setup(env, root, platform); err != nil {
+		return nil, err
+	}
 	return env, nil
 }
 
@@ -208,6 +224,14 @@ func setAndroidEnv(env *envutil.Snapshot, platform Platform) error {
 	env.Set("GOARCH", platform.Arch)
 	env.Set("GOARM", strings.TrimPrefix(platform.SubArch, "v"))
 
+	ndkHome, err := androidNDKHome(root)
+	if err != nil {
+		return err
+	}
+	if err := setAndroidCgoEnv(env, ndkHome, platform); err != nil {
+		return err
+	}
+
 	// Add the paths to vanadium cross-compilation tools to the PATH.
 	path := env.GetTokens("PATH", ":")
 	path = append([]string{
@@ -217,6 +241,69 @@ func setAndroidEnv(env *envutil.Snapshot, platform Platform) error {
 	return nil
 }
 
+// androidNDKHome discovers the root of the Android NDK to use for
+// cross-compilation, preferring NDKHome, ANDROID_NDK_HOME, NDK_ROOT,
+// $ANDROID_HOME/ndk-bundle, and finally the NDK vendored in the tree.
+func androidNDKHome(root string) (string, error) {
+	if NDKHome != "" {
+		return NDKHome, nil
+	}
+	if home := os.Getenv("ANDROID_NDK_HOME"); home != "" {
+		return home, nil
+	}
+	if home := os.Getenv("NDK_ROOT"); home != "" {
+		return home, nil
+	}
+	if androidHome := os.Getenv("ANDROID_HOME"); androidHome != "" {
+		bundle := filepath.Join(androidHome, "ndk-bundle")
+		if _, err := os.Stat(bundle); err == nil {
+			return bundle, nil
+		}
+	}
+	vendored := filepath.Join(root, "third_party", "android", "ndk")
+	if _, err := os.Stat(vendored); err != nil {
+		if !os.IsNotExist(err) {
+			return "", fmt.Errorf("Stat(%v) failed: %v", vendored, err)
+		}
+		return "", fmt.Errorf("no Android NDK found; set --ndk, ANDROID_NDK_HOME, NDK_ROOT, or ANDROID_HOME")
+	}
+	return vendored, nil
+}
+
+// setAndroidCgoEnv configures CC, CXX, AR, CGO_CFLAGS, and CGO_LDFLAGS
+// for the NDK's clang toolchain wrappers, using platform.AndroidAPILevel
+// to pick the sysroot.
+func setAndroidCgoEnv(env *envutil.Snapshot, ndkHome string, platform Platform) error {
+	triple, ok := androidToolchainArch[platform.Arch]
+	if !ok {
+		return UnsupportedPlatformErr{platform}
+	}
+	sysrootArch, ok := androidNDKSysrootArch[platform.Arch]
+	if !ok {
+		return UnsupportedPlatformErr{platform}
+	}
+	apiLevel := platform.AndroidAPILevel
+	if apiLevel == 0 {
+		apiLevel = defaultAndroidAPILevel
+	}
+	host := runtime.GOOS + "-x86_64"
+	bin := filepath.Join(ndkHome, "toolchains", "llvm", "prebuilt", host, "bin")
+	sysroot := filepath.Join(ndkHome, "platforms", fmt.Sprintf("android-%d", apiLevel), sysrootArch)
+
+	env.Set("CC", filepath.Join(bin, fmt.Sprintf("%s%d-clang", triple, apiLevel)))
+	env.Set("CXX", filepath.Join(bin, fmt.Sprintf("%s%d-clang++", triple, apiLevel)))
+	env.Set("AR", filepath.Join(bin, triple+"-ar"))
+
+	cflags := env.GetTokens("CGO_CFLAGS", " ")
+	cflags = append(cflags, "--sysroot="+sysroot)
+	env.SetTokens("CGO_CFLAGS", cflags, " ")
+
+	ldflags := env.GetTokens("CGO_LDFLAGS", " ")
+	ldflags = append(ldflags, "--sysroot="+sysroot)
+	env.SetTokens("CGO_LDFLAGS", ldflags, " ")
+	return nil
+}
+
 // setArmEnv sets the environment variables used for android
 // cross-compilation.
 func setArmEnv(env *envutil.Snapshot, platform Platform) error {
@@ -240,8 +327,17 @@ func setArmEnv(env *envutil.Snapshot, platform Platform) error {
 }
 
 // setGoPath adds the paths to vanadium Go workspaces to the GOPATH
-// variable.
-func setGoPath(env *envutil.Snapshot, root string, config *Config) {
+// variable. If goroot is non-empty, it is set as GOROOT and its bin
+// directory is prepended to PATH, so that the pinned Go toolchain
+// resolved by EnsureGoToolchain takes precedence over whatever "go" is
+// on the user's PATH.
+func setGoPath(env *envutil.Snapshot, root string, config *Config, goroot string) {
+	if goroot != "" {
+		env.Set("GOROOT", goroot)
+		path := env.GetTokens("PATH", ":")
+		path = append([]string{filepath.Join(goroot, "bin")}, path...)
+		env.SetTokens("PATH", path, ":")
+	}
 	gopath := env.GetTokens("GOPATH", ":")
 	// Append an entry to gopath for each vanadium go workspace.
 	for _, workspace := range config.GoWorkspaces() {
@@ -299,9 +395,5 @@ func setSyncbaseCgoEnv(env *envutil.Snapshot, root, arch string) error {
 
 // BuildCopRotationPath returns the path to the build cop rotation file.
 func BuildCopRotationPath(ctx *tool.Context) (string, error) {
-	dataDir, err := DataDirPath(ctx, tool.Name)
-	if err != nil {
-		return "", err
-	}
-	return filepath.Join(dataDir, "buildcop.xml"), nil
+	return NewDataProvider(ctx, tool.Name).ConfigPath("buildcop.xml")
 }
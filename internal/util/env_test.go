@@ -0,0 +1,54 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAndroidNDKHome(t *testing.T) {
+	root, err := ioutil.TempDir("", "jiri-test-")
+	if err != nil {
+		t.Fatalf("TempDir() failed: %v", err)
+	}
+	defer os.RemoveAll(root)
+
+	reset := func() {
+		NDKHome = ""
+		os.Unsetenv("ANDROID_NDK_HOME")
+		os.Unsetenv("NDK_ROOT")
+		os.Unsetenv("ANDROID_HOME")
+	}
+	defer reset()
+
+	reset()
+	if _, err := androidNDKHome(root); err == nil {
+		t.Errorf("androidNDKHome() succeeded when no NDK was available")
+	}
+
+	reset()
+	vendored := filepath.Join(root, "third_party", "android", "ndk")
+	if err := os.MkdirAll(vendored, 0755); err != nil {
+		t.Fatalf("MkdirAll(%v) failed: %v", vendored, err)
+	}
+	if got, err := androidNDKHome(root); err != nil || got != vendored {
+		t.Errorf("androidNDKHome() = %v, %v, want %v, nil", got, err, vendored)
+	}
+
+	reset()
+	os.Setenv("ANDROID_NDK_HOME", "/env/ndk")
+	if got, err := androidNDKHome(root); err != nil || got != "/env/ndk" {
+		t.Errorf("androidNDKHome() = %v, %v, want /env/ndk, nil", got, err)
+	}
+
+	reset()
+	NDKHome = "/flag/ndk"
+	if got, err := androidNDKHome(root); err != nil || got != "/flag/ndk" {
+		t.Errorf("androidNDKHome() = %v, %v, want /flag/ndk, nil", got, err)
+	}
+}
@@ -0,0 +1,263 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package util
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"v.io/x/devtools/internal/tool"
+)
+
+// goToolchainRevFile holds the pinned "<rev> <sha256>" Go toolchain
+// revision and checksum, rooted at V23Root().
+const goToolchainRevFile = "go.toolchain.rev"
+
+// goToolchainURLFmt is the URL template for a pinned Go toolchain tarball.
+const goToolchainURLFmt = "https://storage.googleapis.com/vanadium-go-toolchains/go-%s.tar.gz"
+
+// EnsureGoToolchain downloads, verifies, and caches the Go toolchain
+// pinned by go.toolchain.rev under $V23_ROOT/.cache, and returns its
+// GOROOT. A missing go.toolchain.rev is not an error: EnsureGoToolchain
+// returns an empty goroot, so setGoPath falls back to "go" on PATH. It
+// also returns an empty goroot, without downloading anything, when the
+// toolchain is not cached yet and "go" on PATH already reports the
+// pinned revision.
+func EnsureGoToolchain(ctx *tool.Context) (string, error) {
+	root, err := V23Root()
+	if err != nil {
+		return "", err
+	}
+	rev, checksum, err := readGoToolchainRev(root)
+	if err != nil {
+		return "", err
+	}
+	if rev == "" {
+		return "", nil
+	}
+	cacheDir := filepath.Join(root, ".cache", "go-"+rev)
+	goroot := filepath.Join(cacheDir, "go")
+	marker := filepath.Join(cacheDir, ".extracted")
+
+	if _, err := os.Stat(marker); err == nil {
+		return goroot, nil
+	}
+	if goVersionMatches(rev) {
+		return "", nil
+	}
+
+	archive, cleanup, err := downloadGoToolchain(rev, checksum)
+	if err != nil {
+		return "", err
+	}
+	defer cleanup()
+	if err := extractGoToolchainAtomically(archive, cacheDir, marker); err != nil {
+		return "", err
+	}
+	return goroot, nil
+}
+
+// readGoToolchainRev reads and parses the go.toolchain.rev file.
+func readGoToolchainRev(root string) (rev, checksum string, _ error) {
+	path := filepath.Join(root, goToolchainRevFile)
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", "", nil
+		}
+		return "", "", fmt.Errorf("ReadFile(%v) failed: %v", path, err)
+	}
+	fields := strings.Fields(string(bytes))
+	if len(fields) != 2 {
+		return "", "", fmt.Errorf("%v: expected \"<rev> <sha256>\", got %q", path, string(bytes))
+	}
+	return fields[0], fields[1], nil
+}
+
+// goVersionMatches reports whether "go" on PATH already reports rev.
+func goVersionMatches(rev string) bool {
+	out, err := exec.Command("go", "version").Output()
+	if err != nil {
+		return false
+	}
+	return strings.Contains(string(out), rev)
+}
+
+// downloadGoToolchain fetches and checksum-verifies the tarball for rev
+// into a temporary file. cleanup removes it and must be called whenever
+// err is nil; on error the temporary file is already removed and cleanup
+// is nil.
+func downloadGoToolchain(rev, checksum string) (path string, cleanup func(), err error) {
+	url := fmt.Sprintf(goToolchainURLFmt, rev)
+	resp, err := http.Get(url)
+	if err != nil {
+		return "", nil, fmt.Errorf("Get(%v) failed: %v", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", nil, fmt.Errorf("Get(%v) returned status %v", url, resp.Status)
+	}
+	tmp, err := ioutil.TempFile("", "go-toolchain-"+rev+"-")
+	if err != nil {
+		return "", nil, fmt.Errorf("TempFile() failed: %v", err)
+	}
+	cleanup = func() { os.Remove(tmp.Name()) }
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, hash), resp.Body); err != nil {
+		tmp.Close()
+		cleanup()
+		return "", nil, fmt.Errorf("Copy(%v) failed: %v", url, err)
+	}
+	if err := tmp.Close(); err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("Close(%v) failed: %v", tmp.Name(), err)
+	}
+	if got := hex.EncodeToString(hash.Sum(nil)); got != checksum {
+		cleanup()
+		return "", nil, fmt.Errorf("checksum mismatch for %v: got %v, want %v", url, got, checksum)
+	}
+	return tmp.Name(), cleanup, nil
+}
+
+// extractGoToolchainAtomically extracts the tar.gz file archive into
+// a temporary sibling of cacheDir, writes marker inside it, and renames
+// it into place, so concurrent or interrupted jiri invocations see
+// cacheDir either absent or fully extracted with its marker, never partial.
+func extractGoToolchainAtomically(archive, cacheDir, marker string) error {
+	if err := os.MkdirAll(filepath.Dir(cacheDir), 0755); err != nil {
+		return fmt.Errorf("MkdirAll(%v) failed: %v", filepath.Dir(cacheDir), err)
+	}
+	tmpDir := cacheDir + ".tmp-" + strconv.Itoa(os.Getpid())
+	if err := os.RemoveAll(tmpDir); err != nil {
+		return fmt.Errorf("RemoveAll(%v) failed: %v", tmpDir, err)
+	}
+	if err := untar(archive, tmpDir); err != nil {
+		os.RemoveAll(tmpDir)
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(tmpDir, filepath.Base(marker)), nil, 0644); err != nil {
+		os.RemoveAll(tmpDir)
+		return fmt.Errorf("WriteFile(%v) failed: %v", marker, err)
+	}
+	if err := os.Rename(tmpDir, cacheDir); err != nil {
+		os.RemoveAll(tmpDir)
+		// Another invocation may have won the race and already
+		// populated cacheDir; that is fine as long as it finished.
+		if _, statErr := os.Stat(marker); statErr == nil {
+			return nil
+		}
+		return fmt.Errorf("Rename(%v, %v) failed: %v", tmpDir, cacheDir, err)
+	}
+	return nil
+}
+
+// untar extracts the tar.gz archive at path into dir.
+func untar(path, dir string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("Open(%v) failed: %v", path, err)
+	}
+	defer f.Close()
+	gzr, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("NewReader(%v) failed: %v", path, err)
+	}
+	defer gzr.Close()
+	tr := tar.NewReader(gzr)
+	// symlinks records the path within dir of every symlink entry extracted
+	// so far, so that a later entry nesting under one can be rejected: the
+	// symlink targets and entry paths are checked lexically only, so a
+	// later entry written through an extracted symlink could otherwise
+	// land outside dir.
+	symlinks := map[string]bool{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("Next(%v) failed: %v", path, err)
+		}
+		target := filepath.Join(dir, hdr.Name)
+		if !withinDir(target, dir) {
+			return fmt.Errorf("%v: tar entry %q escapes extraction directory", path, hdr.Name)
+		}
+		if nestsUnderSymlink(target, dir, symlinks) {
+			return fmt.Errorf("%v: tar entry %q nests under a previously extracted symlink", path, hdr.Name)
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, os.FileMode(hdr.Mode)); err != nil {
+				return fmt.Errorf("MkdirAll(%v) failed: %v", target, err)
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return fmt.Errorf("MkdirAll(%v) failed: %v", filepath.Dir(target), err)
+			}
+			out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(hdr.Mode))
+			if err != nil {
+				return fmt.Errorf("OpenFile(%v) failed: %v", target, err)
+			}
+			if _, err := io.Copy(out, tr); err != nil {
+				out.Close()
+				return fmt.Errorf("Copy(%v) failed: %v", target, err)
+			}
+			if err := out.Close(); err != nil {
+				return fmt.Errorf("Close(%v) failed: %v", target, err)
+			}
+		case tar.TypeSymlink:
+			linkTarget := hdr.Linkname
+			if !filepath.IsAbs(linkTarget) {
+				linkTarget = filepath.Join(filepath.Dir(target), linkTarget)
+			}
+			if !withinDir(filepath.Clean(linkTarget), dir) {
+				return fmt.Errorf("%v: tar entry %q has a symlink target %q that escapes the extraction directory", path, hdr.Name, hdr.Linkname)
+			}
+			if err := os.Symlink(hdr.Linkname, target); err != nil {
+				return fmt.Errorf("Symlink(%v, %v) failed: %v", hdr.Linkname, target, err)
+			}
+			symlinks[target] = true
+		case tar.TypeLink:
+			oldname := filepath.Join(dir, hdr.Linkname)
+			if !withinDir(oldname, dir) {
+				return fmt.Errorf("%v: tar entry %q has a hardlink target %q that escapes the extraction directory", path, hdr.Name, hdr.Linkname)
+			}
+			if err := os.Link(oldname, target); err != nil {
+				return fmt.Errorf("Link(%v, %v) failed: %v", oldname, target, err)
+			}
+		default:
+			return fmt.Errorf("%v: unsupported tar entry type %v for %q", path, hdr.Typeflag, hdr.Name)
+		}
+	}
+}
+
+// withinDir reports whether target is dir itself or a descendant of dir.
+func withinDir(target, dir string) bool {
+	dir = filepath.Clean(dir)
+	target = filepath.Clean(target)
+	return target == dir || strings.HasPrefix(target, dir+string(os.PathSeparator))
+}
+
+// nestsUnderSymlink reports whether target has a path component, other
+// than itself, that was previously extracted as a symlink.
+func nestsUnderSymlink(target, dir string, symlinks map[string]bool) bool {
+	for cur := filepath.Dir(target); withinDir(cur, dir) && cur != dir; cur = filepath.Dir(cur) {
+		if symlinks[cur] {
+			return true
+		}
+	}
+	return false
+}
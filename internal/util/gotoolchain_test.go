@@ -0,0 +1,154 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package util
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTarGz(t *testing.T, dir string, entries []*tar.Header, contents map[string]string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	gzw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gzw)
+	for _, hdr := range entries {
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatalf("WriteHeader(%v) failed: %v", hdr.Name, err)
+		}
+		if body, ok := contents[hdr.Name]; ok {
+			if _, err := tw.Write([]byte(body)); err != nil {
+				t.Fatalf("Write(%v) failed: %v", hdr.Name, err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("tar Close() failed: %v", err)
+	}
+	if err := gzw.Close(); err != nil {
+		t.Fatalf("gzip Close() failed: %v", err)
+	}
+	path := filepath.Join(dir, "archive.tar.gz")
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("WriteFile(%v) failed: %v", path, err)
+	}
+	return path
+}
+
+func TestUntarRegularAndSymlink(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "jiri-test-")
+	if err != nil {
+		t.Fatalf("TempDir() failed: %v", err)
+	}
+	defer os.RemoveAll(tmp)
+	archive := writeTarGz(t, tmp, []*tar.Header{
+		{Name: "bin", Typeflag: tar.TypeDir, Mode: 0755},
+		{Name: "bin/go", Typeflag: tar.TypeReg, Mode: 0755, Size: int64(len("#!/bin/sh"))},
+		{Name: "bin/gofmt", Typeflag: tar.TypeSymlink, Linkname: "go"},
+	}, map[string]string{"bin/go": "#!/bin/sh"})
+
+	dir := filepath.Join(tmp, "out")
+	if err := untar(archive, dir); err != nil {
+		t.Fatalf("untar() failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "bin", "go")); err != nil {
+		t.Errorf("bin/go not extracted: %v", err)
+	}
+	link, err := os.Readlink(filepath.Join(dir, "bin", "gofmt"))
+	if err != nil {
+		t.Fatalf("Readlink() failed: %v", err)
+	}
+	if link != "go" {
+		t.Errorf("Readlink() = %q, want %q", link, "go")
+	}
+}
+
+func TestUntarRejectsPathTraversal(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "jiri-test-")
+	if err != nil {
+		t.Fatalf("TempDir() failed: %v", err)
+	}
+	defer os.RemoveAll(tmp)
+	archive := writeTarGz(t, tmp, []*tar.Header{
+		{Name: "../evil", Typeflag: tar.TypeReg, Mode: 0644, Size: 4},
+	}, map[string]string{"../evil": "evil"})
+
+	dir := filepath.Join(tmp, "out")
+	if err := untar(archive, dir); err == nil {
+		t.Errorf("untar() succeeded on a path-traversal entry")
+	}
+}
+
+func TestUntarRejectsSymlinkEscape(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "jiri-test-")
+	if err != nil {
+		t.Fatalf("TempDir() failed: %v", err)
+	}
+	defer os.RemoveAll(tmp)
+	archive := writeTarGz(t, tmp, []*tar.Header{
+		{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "../../etc"},
+		{Name: "link/evil", Typeflag: tar.TypeReg, Mode: 0644, Size: 4},
+	}, map[string]string{"link/evil": "evil"})
+
+	dir := filepath.Join(tmp, "out")
+	if err := untar(archive, dir); err == nil {
+		t.Errorf("untar() succeeded on a tar entry with a symlink that escapes the extraction directory")
+	}
+}
+
+func TestUntarRejectsEntryNestedUnderSymlink(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "jiri-test-")
+	if err != nil {
+		t.Fatalf("TempDir() failed: %v", err)
+	}
+	defer os.RemoveAll(tmp)
+	archive := writeTarGz(t, tmp, []*tar.Header{
+		{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "."},
+		{Name: "link/evil", Typeflag: tar.TypeReg, Mode: 0644, Size: 4},
+	}, map[string]string{"link/evil": "evil"})
+
+	dir := filepath.Join(tmp, "out")
+	if err := untar(archive, dir); err == nil {
+		t.Errorf("untar() succeeded on a tar entry nested under a symlink")
+	}
+}
+
+func TestReadGoToolchainRev(t *testing.T) {
+	root, err := ioutil.TempDir("", "jiri-test-")
+	if err != nil {
+		t.Fatalf("TempDir() failed: %v", err)
+	}
+	defer os.RemoveAll(root)
+
+	if rev, checksum, err := readGoToolchainRev(root); err != nil || rev != "" || checksum != "" {
+		t.Errorf("readGoToolchainRev() = %q, %q, %v, want \"\", \"\", nil", rev, checksum, err)
+	}
+
+	path := filepath.Join(root, goToolchainRevFile)
+	if err := ioutil.WriteFile(path, []byte("go1.9.1 "+sampleSHA256+"\n"), 0644); err != nil {
+		t.Fatalf("WriteFile(%v) failed: %v", path, err)
+	}
+	rev, checksum, err := readGoToolchainRev(root)
+	if err != nil {
+		t.Fatalf("readGoToolchainRev() failed: %v", err)
+	}
+	if rev != "go1.9.1" || checksum != sampleSHA256 {
+		t.Errorf("readGoToolchainRev() = %q, %q, want go1.9.1, %v", rev, checksum, sampleSHA256)
+	}
+
+	if err := ioutil.WriteFile(path, []byte("malformed"), 0644); err != nil {
+		t.Fatalf("WriteFile(%v) failed: %v", path, err)
+	}
+	if _, _, err := readGoToolchainRev(root); err == nil {
+		t.Errorf("readGoToolchainRev() succeeded on a malformed file")
+	}
+}
+
+const sampleSHA256 = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
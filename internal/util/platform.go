@@ -0,0 +1,35 @@
+// Copyright 2015 The Vanadium Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package util
+
+import "fmt"
+
+// Platform represents a Go cross-compilation target.
+type Platform struct {
+	Arch    string
+	OS      string
+	SubArch string
+
+	// AndroidAPILevel selects the Android sysroot to build against; it
+	// defaults to defaultAndroidAPILevel when zero.
+	AndroidAPILevel int
+}
+
+func (p Platform) String() string {
+	if p.SubArch != "" {
+		return fmt.Sprintf("%s%s/%s", p.Arch, p.SubArch, p.OS)
+	}
+	return fmt.Sprintf("%s/%s", p.Arch, p.OS)
+}
+
+// UnsupportedPlatformErr indicates that cross-compiling for Platform is
+// not supported.
+type UnsupportedPlatformErr struct {
+	Platform Platform
+}
+
+func (e UnsupportedPlatformErr) Error() string {
+	return fmt.Sprintf("unsupported platform %v", e.Platform)
+}